@@ -0,0 +1,191 @@
+package fmtcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/Kunde21/markdownfmt/v2/internal/diff"
+)
+
+// fileCheckResult is one entry of a -check report: whether a file would
+// change, and (if so) the hunks that change and the full formatted
+// content (used to build a SARIF fix, but never itself marshaled).
+type fileCheckResult struct {
+	Path    string      `json:"path"`
+	Changed bool        `json:"changed"`
+	Hunks   []diff.Hunk `json:"hunks,omitempty"`
+
+	formatted []byte
+	src       []byte
+}
+
+// runCheck implements Options.Check: it formats every file named by paths
+// (or standard input, if paths is empty) without writing anything back,
+// then emits a report in the format named by Options.Output. It returns
+// exit code 1 if any file would change, so it can gate a CI pipeline.
+func (r *runner) runCheck(paths []string) (int, error) {
+	files, err := r.collectCheckFiles(paths)
+	if err != nil {
+		return 2, err
+	}
+
+	n := r.opts.Parallel
+	if n < 1 {
+		n = 1
+	}
+	sem := semaphore.NewWeighted(int64(n))
+
+	results := make([]fileCheckResult, len(files))
+	done := make([]bool, len(files))
+	var wg sync.WaitGroup
+	for i, path := range files {
+		i, path := i, path
+		if err := sem.Acquire(context.Background(), 1); err != nil {
+			panic(err) // context.Background never cancels or times out
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+
+			res, err := r.checkFile(path)
+			if err != nil {
+				r.report(err)
+				return
+			}
+			results[i] = res
+			done[i] = true
+		}()
+	}
+	wg.Wait()
+
+	completed := completedResults(results, done)
+
+	if err := r.writeCheckReport(completed); err != nil {
+		return 2, err
+	}
+
+	code := int(atomic.LoadInt32(&r.exitCode))
+	for _, res := range completed {
+		if res.Changed && code < 1 {
+			code = 1
+		}
+	}
+	return code, nil
+}
+
+// collectCheckFiles walks paths the same way Run does for normal
+// formatting, but gathers the resulting file list up front instead of
+// dispatching work immediately, so check results can be indexed by
+// position and reported together once every file has been formatted.
+func (r *runner) collectCheckFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return []string{"<standard input>"}, nil
+	}
+
+	var files []string
+	for _, path := range paths {
+		dir, err := os.Stat(path)
+		if err != nil {
+			r.report(err)
+			continue
+		}
+		if !dir.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(p string, f os.FileInfo, err error) error {
+			if err != nil {
+				r.report(err)
+				return nil
+			}
+			if skip := r.skipDir(f); skip != nil {
+				return skip
+			}
+			if r.isMarkdownFile(f) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func (r *runner) checkFile(path string) (fileCheckResult, error) {
+	var src []byte
+	var err error
+	if path == "<standard input>" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return fileCheckResult{}, err
+	}
+
+	res, err := r.format(path, src)
+	if err != nil {
+		return fileCheckResult{}, err
+	}
+	if bytes.Equal(src, res) {
+		return fileCheckResult{Path: path, Changed: false}, nil
+	}
+	return fileCheckResult{
+		Path:      path,
+		Changed:   true,
+		Hunks:     diff.Hunks(src, res, diffContext),
+		formatted: res,
+		src:       src,
+	}, nil
+}
+
+// completedResults filters results down to the entries whose goroutine
+// actually finished (done[i] true), dropping the zero-value placeholders an
+// errored checkFile call would otherwise leave behind at their index.
+func completedResults(results []fileCheckResult, done []bool) []fileCheckResult {
+	completed := results[:0]
+	for i, res := range results {
+		if done[i] {
+			completed = append(completed, res)
+		}
+	}
+	return completed
+}
+
+func (r *runner) writeCheckReport(results []fileCheckResult) error {
+	switch r.opts.Output {
+	case "json":
+		return writeJSONReport(r.opts.Stdout, results)
+	case "sarif":
+		return writeSARIFReport(r.opts.Stdout, results)
+	default:
+		for _, res := range results {
+			if res.Changed {
+				fmt.Fprintln(r.opts.Stdout, res.Path)
+			}
+		}
+		return nil
+	}
+}
+
+func writeJSONReport(w io.Writer, results []fileCheckResult) error {
+	doc := struct {
+		Files []fileCheckResult `json:"files"`
+	}{Files: results}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,91 @@
+package fmtcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompletedResultsDropsUnfinishedEntries(t *testing.T) {
+	results := []fileCheckResult{
+		{Path: "a.md", Changed: true},
+		{}, // b.md errored before its goroutine wrote a result
+		{Path: "c.md", Changed: false},
+	}
+	done := []bool{true, false, true}
+
+	got := completedResults(results, done)
+	if len(got) != 2 {
+		t.Fatalf("completedResults() = %+v, want 2 entries", got)
+	}
+	if got[0].Path != "a.md" || got[1].Path != "c.md" {
+		t.Errorf("completedResults() = %+v, want a.md then c.md", got)
+	}
+	for _, res := range got {
+		if res.Path == "" {
+			t.Errorf("completedResults() kept a zero-Path entry: %+v", res)
+		}
+	}
+}
+
+func TestWriteJSONReportOmitsUnfinishedEntries(t *testing.T) {
+	results := completedResults([]fileCheckResult{
+		{Path: "a.md", Changed: true},
+		{},
+	}, []bool{true, false})
+
+	var buf bytes.Buffer
+	if err := writeJSONReport(&buf, results); err != nil {
+		t.Fatalf("writeJSONReport: %v", err)
+	}
+
+	var doc struct {
+		Files []fileCheckResult `json:"files"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("json.Unmarshal(%s): %v", buf.Bytes(), err)
+	}
+	if len(doc.Files) != 1 || doc.Files[0].Path != "a.md" {
+		t.Errorf("writeJSONReport(%+v) = %s, want a single a.md entry", results, buf.Bytes())
+	}
+}
+
+func TestWriteSARIFReportDescribesChangedFiles(t *testing.T) {
+	results := []fileCheckResult{
+		{Path: "a.md", Changed: false},
+		{
+			Path:      "b.md",
+			Changed:   true,
+			src:       []byte("a\nb\n"),
+			formatted: []byte("a\n\nb\n"),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSARIFReport(&buf, results); err != nil {
+		t.Fatalf("writeSARIFReport: %v", err)
+	}
+
+	var doc sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("json.Unmarshal(%s): %v", buf.Bytes(), err)
+	}
+	if len(doc.Runs) != 1 || len(doc.Runs[0].Results) != 1 {
+		t.Fatalf("writeSARIFReport(%+v) = %s, want exactly one result (only b.md changed)", results, buf.Bytes())
+	}
+	res := doc.Runs[0].Results[0]
+	if !strings.Contains(res.Message.Text, "b.md") {
+		t.Errorf("SARIF result message = %q, want it to mention b.md", res.Message.Text)
+	}
+	if got := res.Locations[0].PhysicalLocation.ArtifactLocation.URI; got != "b.md" {
+		t.Errorf("SARIF result location = %q, want %q", got, "b.md")
+	}
+	fix := res.Fixes[0].ArtifactChanges[0].Replacements[0]
+	if fix.DeletedRegion.EndLine != 2 {
+		t.Errorf("SARIF deletedRegion.EndLine = %d, want 2 (lines in src)", fix.DeletedRegion.EndLine)
+	}
+	if fix.InsertedContent.Text != "a\n\nb\n" {
+		t.Errorf("SARIF insertedContent.text = %q, want the formatted content", fix.InsertedContent.Text)
+	}
+}
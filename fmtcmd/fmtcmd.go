@@ -0,0 +1,464 @@
+// Package fmtcmd implements the markdownfmt command as a library, so that
+// editor plugins, pre-commit hooks, and other tools can format Markdown
+// without shelling out to the markdownfmt binary. It mirrors the layout of
+// hashicorp/hcl's hcl/fmtcmd: a single Options struct configures behavior
+// and Run does the work a CLI's main would otherwise do inline.
+package fmtcmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/Kunde21/markdownfmt/v2/internal/diff"
+	"github.com/Kunde21/markdownfmt/v2/markdown"
+)
+
+// diffContext is the number of unchanged lines of context shown around
+// each hunk in -d output, matching diff -u's default.
+const diffContext = 3
+
+// ErrWriteStdin is returned by Run when Options.Write is set but no paths
+// are given (and Options.Check is not set), since there is no source file
+// to write the result back to.
+var ErrWriteStdin = errors.New("fmtcmd: cannot use -w (write) with standard input")
+
+// defaultExtensions are the file extensions walked when Options.Extensions
+// is empty.
+var defaultExtensions = []string{".md", ".markdown"}
+
+// defaultSkipDirs are the directory names skipped when Options.SkipDirs is
+// empty.
+var defaultSkipDirs = []string{".git", ".github", "vendor", "node_modules", "third_party"}
+
+// Options controls how Run formats the given paths.
+type Options struct {
+	List    bool // list files whose formatting differs
+	Write   bool // write result back to the source file
+	Diff    bool // print a unified diff instead of rewriting
+	Verbose bool // log each file before processing
+
+	// Rules are raw "-r" style rewrite rule expressions, parsed the same
+	// way the CLI's -r flag is. Simplify, if set, appends the built-in -s
+	// rule bundle after Rules.
+	Rules    []string
+	Simplify bool
+
+	// Parallel bounds how many files are formatted concurrently; <1 means
+	// sequential (equivalent to 1).
+	Parallel int
+
+	// Extensions overrides which file extensions count as Markdown when
+	// walking a directory. Defaults to []string{".md", ".markdown"}.
+	Extensions []string
+
+	// SkipDirs overrides which directory names filepath.Walk skips.
+	// Defaults to []string{".git", ".github", "vendor", "node_modules", "third_party"}.
+	SkipDirs []string
+
+	// FrontMatter controls how a leading YAML/TOML/JSON front-matter block
+	// is treated: "none" formats it as ordinary Markdown content (today's
+	// behavior, which can corrupt it), "preserve" splits it off and
+	// re-emits it verbatim, and "canonical" additionally parses it and
+	// re-serializes it with sorted keys and normalized quoting. Defaults
+	// to "preserve".
+	FrontMatter string
+
+	// Check, if set, never writes files (regardless of Write) and instead
+	// reports which files would change in the format named by Output:
+	// "text" (default, one path per line, like List), "json", or "sarif".
+	// Run returns exit code 1 if any file would change, for use as a CI
+	// gate.
+	Check  bool
+	Output string
+
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run formats each of paths (files or directories) according to opts,
+// writing to opts.Stdout/opts.Stderr, and returns the process exit code
+// markdownfmt's main should use. An empty paths formats standard input
+// instead, reading from os.Stdin (opts.Write is invalid in that case and
+// returns ErrWriteStdin without reading anything, unless opts.Check is set,
+// which ignores Write).
+func Run(paths []string, opts Options) (exitCode int, err error) {
+	if len(paths) == 0 && opts.Write && !opts.Check {
+		return 0, ErrWriteStdin
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+
+	rules, err := parseRFlags(opts.Rules)
+	if err != nil {
+		return 2, err
+	}
+	if opts.Simplify {
+		rules = append(rules, simplifyRules()...)
+	}
+
+	frontMatter := opts.FrontMatter
+	if frontMatter == "" {
+		frontMatter = "preserve"
+	}
+	switch frontMatter {
+	case "none", "preserve", "canonical":
+	default:
+		return 2, fmt.Errorf("fmtcmd: invalid front-matter mode %q (want none, preserve, or canonical)", frontMatter)
+	}
+	opts.FrontMatter = frontMatter
+
+	output := opts.Output
+	if output == "" {
+		output = "text"
+	}
+	switch output {
+	case "text", "json", "sarif":
+	default:
+		return 2, fmt.Errorf("fmtcmd: invalid output format %q (want text, json, or sarif)", output)
+	}
+	opts.Output = output
+
+	r := &runner{opts: opts, rules: rules}
+
+	if opts.Check {
+		return r.runCheck(paths)
+	}
+
+	if len(paths) == 0 {
+		if err := r.processFile("<standard input>", os.Stdin, opts.Stdout); err != nil {
+			r.report(err)
+		}
+		return int(atomic.LoadInt32(&r.exitCode)), nil
+	}
+
+	n := opts.Parallel
+	if n < 1 {
+		n = 1
+	}
+	r.seq = newSequencer(int64(n), opts.Stdout)
+	r.seq.r = r
+
+	for _, path := range paths {
+		path := path
+		switch dir, err := os.Stat(path); {
+		case err != nil:
+			r.reportSequenced(err)
+		case dir.IsDir():
+			if err := r.walkDir(path); err != nil {
+				r.reportSequenced(err)
+			}
+		default:
+			r.submit(path)
+		}
+	}
+	r.seq.wait()
+
+	return int(atomic.LoadInt32(&r.exitCode)), nil
+}
+
+// runner holds the state needed while formatting a batch of paths: the
+// options in effect, the rules parsed from them, output ordering, and the
+// accumulated exit code.
+type runner struct {
+	opts     Options
+	rules    []rewriteRule
+	seq      *sequencer
+	exitCode int32
+}
+
+func (r *runner) report(err error) {
+	fmt.Fprintln(r.opts.Stderr, err)
+	r.setExitCode(2)
+}
+
+// reportSequenced routes err through the sequencer as a no-output task, so
+// that an os.Stat/filepath.Walk failure discovered on the main goroutine is
+// reported in the same submission order as the files around it, instead of
+// jumping ahead of buffered output from files still waiting for their turn.
+func (r *runner) reportSequenced(err error) {
+	r.seq.add(func() ([]byte, error) {
+		return nil, err
+	})
+}
+
+// setExitCode raises the exit code to code unless it has already been
+// raised at least that far by another concurrently processed file. It
+// never lowers it.
+func (r *runner) setExitCode(code int32) {
+	for {
+		old := atomic.LoadInt32(&r.exitCode)
+		if old >= code {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&r.exitCode, old, code) {
+			return
+		}
+	}
+}
+
+func (r *runner) skipDir(f os.FileInfo) error {
+	if !f.IsDir() {
+		return nil
+	}
+	names := r.opts.SkipDirs
+	if len(names) == 0 {
+		names = defaultSkipDirs
+	}
+	for _, name := range names {
+		if f.Name() == name {
+			return filepath.SkipDir
+		}
+	}
+	return nil
+}
+
+func (r *runner) isMarkdownFile(f os.FileInfo) bool {
+	name := f.Name()
+	if f.IsDir() || strings.HasPrefix(name, ".") {
+		return false
+	}
+	exts := r.opts.Extensions
+	if len(exts) == 0 {
+		exts = defaultExtensions
+	}
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// format splits off a leading front-matter block (per opts.FrontMatter),
+// formats the remaining body, and reassembles the two. Front matter is
+// never fed through the Markdown formatter, which doesn't understand
+// YAML/TOML/JSON and would otherwise corrupt it; a failure canonicalizing
+// it is reported but does not stop the body from being formatted.
+func (r *runner) format(filename string, src []byte) ([]byte, error) {
+	if r.opts.FrontMatter == "none" {
+		return r.formatBody(filename, src)
+	}
+
+	front, format, body, ok := splitFrontMatter(src)
+	if !ok {
+		return r.formatBody(filename, src)
+	}
+
+	formattedBody, err := r.formatBody(filename, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.opts.FrontMatter == "canonical" {
+		if canon, err := canonicalizeFrontMatter(front, format); err != nil {
+			r.report(fmt.Errorf("%s: canonicalizing front matter: %w", filename, err))
+		} else {
+			front = canon
+		}
+	}
+
+	out := make([]byte, 0, len(front)+len(formattedBody))
+	out = append(out, front...)
+	out = append(out, formattedBody...)
+	return out, nil
+}
+
+// formatBody renders src through markdown.Process, unless -r/-s rules are
+// in effect, in which case it first inlines single-use reference links (a
+// text-level, -s-only pass), then parses to a goldmark AST, applies the
+// rules to a fixed point, and renders with the same renderer
+// markdown.Process itself uses.
+func (r *runner) formatBody(filename string, src []byte) ([]byte, error) {
+	if len(r.rules) == 0 {
+		return markdown.Process(filename, src)
+	}
+
+	if r.opts.Simplify {
+		src = inlineSingleUseReferenceLinks(src)
+	}
+
+	renderer := markdown.NewRenderer()
+	gm := goldmark.New(goldmark.WithRenderer(renderer))
+	doc := gm.Parser().Parse(text.NewReader(src))
+
+	if err := applyRewrites(doc, &src, r.rules); err != nil {
+		return nil, fmt.Errorf("applying rewrite rules to %s: %w", filename, err)
+	}
+
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, src, doc); err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", filename, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// processFile formats filename (reading from in if non-nil, otherwise
+// opening filename) and writes whatever List/Write/Diff/default dictates
+// to out. Besides the file itself and out, the only shared state it touches
+// is the exit code, which it raises atomically, and opts.Stderr, to which it
+// writes the -v log line and front-matter errors directly rather than
+// through the sequencer. It is called concurrently for different files,
+// each call with its own out.
+func (r *runner) processFile(filename string, in io.Reader, out io.Writer) error {
+	if r.opts.Verbose {
+		fmt.Fprintln(r.opts.Stderr, filename)
+	}
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.format(filename, src)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(src, res) {
+		// formatting has changed
+		if r.opts.List {
+			fmt.Fprintln(out, filename)
+		}
+		if r.opts.Write {
+			if err := ioutil.WriteFile(filename, res, 0); err != nil {
+				return err
+			}
+		}
+		if r.opts.Diff {
+			fmt.Fprintf(out, "diff %s markdownfmt/%s\n", filename, filename)
+			data := diff.Diff(filename, filename, src, res, diffContext)
+			if _, err := out.Write(data); err != nil {
+				return fmt.Errorf("writing out: %s", err)
+			}
+			r.setExitCode(1)
+		}
+	}
+
+	if !r.opts.List && !r.opts.Write && !r.opts.Diff {
+		_, err = out.Write(res)
+	}
+
+	return err
+}
+
+// visitFile is called by filepath.Walk for every directory entry.
+// Markdown files are handed off to submit so that formatting can happen in
+// parallel while output stays in Walk order.
+func (r *runner) visitFile(path string, f os.FileInfo, err error) error {
+	if err == nil {
+		if skip := r.skipDir(f); skip != nil {
+			return skip
+		} else if r.isMarkdownFile(f) {
+			r.submit(path)
+			return nil
+		}
+	}
+	if err != nil {
+		r.reportSequenced(err)
+	}
+	return nil
+}
+
+func (r *runner) walkDir(path string) error {
+	return filepath.Walk(path, r.visitFile)
+}
+
+// submit schedules filename to be formatted on the worker pool, preserving
+// its position in the eventual output.
+func (r *runner) submit(filename string) {
+	r.seq.add(func() ([]byte, error) {
+		var buf bytes.Buffer
+		err := r.processFile(filename, nil, &buf)
+		return buf.Bytes(), err
+	})
+}
+
+// sequencer runs work submitted via add concurrently, bounded by a
+// semaphore sized to Options.Parallel, while guaranteeing that each task's
+// bytes land on out in the order add was called and that any error it
+// returns is reported in that same order. This keeps markdownfmt's
+// stdout/exit-code behavior byte-for-byte identical to sequential
+// processing, even though formatting itself happens in parallel.
+type sequencer struct {
+	sem *semaphore.Weighted
+	out io.Writer
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	next uint64 // next token to hand out
+	turn uint64 // next token allowed to write
+	wg   sync.WaitGroup
+
+	r *runner
+}
+
+func newSequencer(maxConcurrent int64, out io.Writer) *sequencer {
+	s := &sequencer{sem: semaphore.NewWeighted(maxConcurrent), out: out}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// add runs work on the worker pool once a slot is free. work's result is
+// written (and any error reported) only once every task submitted before
+// it has already done the same.
+func (s *sequencer) add(work func() ([]byte, error)) {
+	s.mu.Lock()
+	tok := s.next
+	s.next++
+	s.mu.Unlock()
+
+	if err := s.sem.Acquire(context.Background(), 1); err != nil {
+		// context.Background never cancels or times out.
+		panic(err)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		data, err := work()
+		s.sem.Release(1)
+
+		s.mu.Lock()
+		for s.turn != tok {
+			s.cond.Wait()
+		}
+		if len(data) > 0 {
+			s.out.Write(data)
+		}
+		if err != nil && s.r != nil {
+			s.r.report(err)
+		}
+		s.turn++
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}()
+}
+
+func (s *sequencer) wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,66 @@
+package fmtcmd
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestSequencerPreservesSubmissionOrder runs tasks concurrently with
+// randomized completion delays and checks that add's output still lands on
+// out in submission order, not completion order.
+func TestSequencerPreservesSubmissionOrder(t *testing.T) {
+	var out bytes.Buffer
+	seq := newSequencer(4, &out)
+
+	const n = 20
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < n; i++ {
+		i := i
+		delay := time.Duration(rng.Intn(5)) * time.Millisecond
+		seq.add(func() ([]byte, error) {
+			time.Sleep(delay)
+			return []byte(fmt.Sprintf("%d\n", i)), nil
+		})
+	}
+	seq.wait()
+
+	var want bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&want, "%d\n", i)
+	}
+	if out.String() != want.String() {
+		t.Errorf("sequencer output =\n%s\nwant\n%s", out.String(), want.String())
+	}
+}
+
+// TestSequencerReportsErrorsInOrder checks that a task's error is reported
+// (via runner.report, here driven through a stub runner) in the same
+// submission order as output, even though it completes out of order.
+func TestSequencerReportsErrorsInOrder(t *testing.T) {
+	var out bytes.Buffer
+	seq := newSequencer(4, &out)
+	r := &runner{opts: Options{Stderr: &out}}
+	seq.r = r
+
+	seq.add(func() ([]byte, error) {
+		time.Sleep(2 * time.Millisecond)
+		return []byte("a\n"), nil
+	})
+	seq.add(func() ([]byte, error) {
+		return nil, fmt.Errorf("boom")
+	})
+	seq.add(func() ([]byte, error) {
+		return []byte("c\n"), nil
+	})
+	seq.wait()
+
+	if out.String() != "a\nboom\nc\n" {
+		t.Errorf("sequencer output = %q, want %q", out.String(), "a\nboom\nc\n")
+	}
+	if code := r.exitCode; code != 2 {
+		t.Errorf("exitCode = %d, want 2 (from the reported error)", code)
+	}
+}
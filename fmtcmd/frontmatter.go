@@ -0,0 +1,236 @@
+package fmtcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatterFormat identifies which serialization a front-matter block
+// uses, detected from its opening delimiter.
+type frontMatterFormat int
+
+const (
+	frontMatterYAML frontMatterFormat = iota
+	frontMatterTOML
+	frontMatterJSON
+)
+
+var (
+	yamlDelim = []byte("---")
+	tomlDelim = []byte("+++")
+)
+
+// splitFrontMatter separates a leading front-matter block from the rest of
+// src: a YAML block delimited by "---" lines, a TOML block delimited by
+// "+++" lines, or a top-level JSON object. front includes the delimiters
+// (or, for JSON, the object itself) so that "preserve" mode can re-emit it
+// byte-for-byte. ok is false if src has no front matter, in which case
+// body equals src.
+func splitFrontMatter(src []byte) (front []byte, format frontMatterFormat, body []byte, ok bool) {
+	line, rest, hasLine := cutLine(src)
+	if !hasLine {
+		return nil, 0, src, false
+	}
+	switch trimmed := bytes.TrimRight(line, "\r\n"); {
+	case bytes.Equal(trimmed, yamlDelim):
+		return splitDelimited(src, line, rest, frontMatterYAML)
+	case bytes.Equal(trimmed, tomlDelim):
+		return splitDelimited(src, line, rest, frontMatterTOML)
+	case len(bytes.TrimSpace(trimmed)) > 0 && trimmed[0] == '{':
+		return splitJSONFrontMatter(src)
+	default:
+		return nil, 0, src, false
+	}
+}
+
+// cutLine splits off the first line of b, including its trailing newline.
+// ok is false if b has no newline (e.g. the whole file is one line).
+func cutLine(b []byte) (line, rest []byte, ok bool) {
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return b, nil, false
+	}
+	return b[:i+1], b[i+1:], true
+}
+
+// splitDelimited finds the line matching openLine's delimiter (the first
+// line of src) later in rest, and splits src there.
+func splitDelimited(src, openLine, rest []byte, format frontMatterFormat) (front []byte, f frontMatterFormat, body []byte, ok bool) {
+	delim := bytes.TrimRight(openLine, "\r\n")
+	offset := len(openLine)
+	for len(rest) > 0 {
+		line, next, _ := cutLine(rest)
+		if bytes.Equal(bytes.TrimRight(line, "\r\n"), delim) {
+			end := offset + len(line)
+			return src[:end], format, src[end:], true
+		}
+		offset += len(line)
+		rest = next
+	}
+	return nil, 0, src, false
+}
+
+// splitJSONFrontMatter consumes a single top-level JSON value from the
+// start of src (Hugo/MkDocs' JSON front-matter convention) using
+// json.Decoder's input offset to find exactly where it ends, rather than
+// trying to balance braces by hand.
+func splitJSONFrontMatter(src []byte) (front []byte, format frontMatterFormat, body []byte, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, 0, src, false
+	}
+	n := dec.InputOffset()
+	return src[:n], frontMatterJSON, src[n:], true
+}
+
+// canonicalizeFrontMatter parses front and re-serializes it with sorted
+// keys, a single consistent delimiter style, and normalized quoting.
+func canonicalizeFrontMatter(front []byte, format frontMatterFormat) ([]byte, error) {
+	switch format {
+	case frontMatterYAML:
+		return canonicalYAML(front)
+	case frontMatterTOML:
+		return canonicalTOML(front)
+	case frontMatterJSON:
+		return canonicalJSON(front)
+	default:
+		return front, nil
+	}
+}
+
+// innerBlock returns the lines of a delimited front-matter block between
+// its opening and closing delimiter lines.
+func innerBlock(front []byte) []byte {
+	lines := bytes.SplitAfter(front, []byte("\n"))
+	// SplitAfter leaves a trailing empty element when front ends in "\n";
+	// drop it so the real closing delimiter line ends up last.
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) < 2 {
+		return nil
+	}
+	return bytes.Join(lines[1:len(lines)-1], nil)
+}
+
+func canonicalYAML(front []byte) ([]byte, error) {
+	var data interface{}
+	if err := yaml.Unmarshal(innerBlock(front), &data); err != nil {
+		return nil, err
+	}
+	// yaml.Marshal sorts map[string]interface{} keys lexicographically,
+	// so no explicit sort is needed here.
+	body, err := yaml.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(yamlDelim)
+	buf.WriteByte('\n')
+	buf.Write(body)
+	buf.Write(yamlDelim)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func canonicalJSON(front []byte) ([]byte, error) {
+	var data interface{}
+	if err := json.Unmarshal(front, &data); err != nil {
+		return nil, err
+	}
+	// encoding/json sorts map[string]interface{} keys lexicographically
+	// when marshaling, so no explicit sort is needed here.
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, '\n')
+	return out, nil
+}
+
+// canonicalTOML re-serializes a TOML front-matter block with sorted keys at
+// every level: nested tables (e.g. Hugo's [params]) and arrays of tables
+// decode to map[string]interface{}/[]map[string]interface{} and are
+// rendered back out as sorted inline tables by tomlValue/tomlInlineTable,
+// not left as-is.
+func canonicalTOML(front []byte) ([]byte, error) {
+	var data map[string]interface{}
+	if _, err := toml.Decode(string(innerBlock(front)), &data); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(tomlDelim)
+	buf.WriteByte('\n')
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s = %s\n", k, tomlValue(data[k]))
+	}
+	buf.Write(tomlDelim)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func tomlValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strconv.Quote(x)
+	case bool:
+		return strconv.FormatBool(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case time.Time:
+		return x.Format(time.RFC3339)
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, e := range x {
+			parts[i] = tomlValue(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]interface{}:
+		return tomlInlineTable(x)
+	case []map[string]interface{}:
+		parts := make([]string, len(x))
+		for i, e := range x {
+			parts[i] = tomlInlineTable(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return strconv.Quote(fmt.Sprint(x))
+	}
+}
+
+// tomlInlineTable renders a nested TOML table (e.g. Hugo's [params]) as a
+// sorted inline table, the same way tomlValue sorts top-level keys. Without
+// this, nested tables and arrays of tables decode to map[string]interface{}
+// and fall through tomlValue's default case, silently corrupting them into
+// a quoted Go %v string.
+func tomlInlineTable(x map[string]interface{}) string {
+	keys := make([]string, 0, len(x))
+	for k := range x {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s = %s", k, tomlValue(x[k]))
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
@@ -0,0 +1,135 @@
+package fmtcmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		wantFront  string
+		wantFormat frontMatterFormat
+		wantBody   string
+		wantOK     bool
+	}{
+		{
+			name:       "yaml",
+			src:        "---\ntitle: Hi\n---\n# Body\n",
+			wantFront:  "---\ntitle: Hi\n---\n",
+			wantFormat: frontMatterYAML,
+			wantBody:   "# Body\n",
+			wantOK:     true,
+		},
+		{
+			name:       "toml",
+			src:        "+++\ntitle = \"Hi\"\n+++\n# Body\n",
+			wantFront:  "+++\ntitle = \"Hi\"\n+++\n",
+			wantFormat: frontMatterTOML,
+			wantBody:   "# Body\n",
+			wantOK:     true,
+		},
+		{
+			name:       "json",
+			src:        `{"title": "Hi"}` + "\n# Body\n",
+			wantFront:  `{"title": "Hi"}`,
+			wantFormat: frontMatterJSON,
+			wantBody:   "\n# Body\n",
+			wantOK:     true,
+		},
+		{
+			name:     "no front matter",
+			src:      "# Just a heading\n",
+			wantBody: "# Just a heading\n",
+			wantOK:   false,
+		},
+		{
+			name:     "unterminated yaml block",
+			src:      "---\ntitle: Hi\n# Body\n",
+			wantBody: "---\ntitle: Hi\n# Body\n",
+			wantOK:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, format, body, ok := splitFrontMatter([]byte(tt.src))
+			if ok != tt.wantOK {
+				t.Fatalf("splitFrontMatter(%q) ok = %v, want %v", tt.src, ok, tt.wantOK)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("splitFrontMatter(%q) body = %q, want %q", tt.src, body, tt.wantBody)
+			}
+			if !ok {
+				return
+			}
+			if string(front) != tt.wantFront {
+				t.Errorf("splitFrontMatter(%q) front = %q, want %q", tt.src, front, tt.wantFront)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("splitFrontMatter(%q) format = %v, want %v", tt.src, format, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestCanonicalYAMLSortsKeys(t *testing.T) {
+	front := []byte("---\ntitle: Hi\ndraft: true\ndate: 2020-01-02\n---\n")
+	got, err := canonicalYAML(front)
+	if err != nil {
+		t.Fatalf("canonicalYAML: %v", err)
+	}
+	dateAt := bytes.Index(got, []byte("date:"))
+	draftAt := bytes.Index(got, []byte("draft:"))
+	titleAt := bytes.Index(got, []byte("title:"))
+	if !(dateAt < draftAt && draftAt < titleAt) {
+		t.Errorf("canonicalYAML(%q) = %q, want keys sorted date < draft < title", front, got)
+	}
+}
+
+func TestCanonicalJSONSortsKeys(t *testing.T) {
+	front := []byte(`{"title": "Hi", "draft": true, "date": "2020-01-02"}`)
+	got, err := canonicalJSON(front)
+	if err != nil {
+		t.Fatalf("canonicalJSON: %v", err)
+	}
+	dateAt := bytes.Index(got, []byte(`"date"`))
+	draftAt := bytes.Index(got, []byte(`"draft"`))
+	titleAt := bytes.Index(got, []byte(`"title"`))
+	if !(dateAt < draftAt && draftAt < titleAt) {
+		t.Errorf("canonicalJSON(%q) = %s, want keys sorted date < draft < title", front, got)
+	}
+}
+
+func TestCanonicalTOMLSortsTopLevelKeys(t *testing.T) {
+	front := []byte("+++\ntitle = \"Hi\"\ndraft = true\ndate = \"2020-01-02\"\n+++\n")
+	got, err := canonicalTOML(front)
+	if err != nil {
+		t.Fatalf("canonicalTOML: %v", err)
+	}
+	dateAt := bytes.Index(got, []byte("date ="))
+	draftAt := bytes.Index(got, []byte("draft ="))
+	titleAt := bytes.Index(got, []byte("title ="))
+	if !(dateAt < draftAt && draftAt < titleAt) {
+		t.Errorf("canonicalTOML(%q) = %s, want keys sorted date < draft < title", front, got)
+	}
+}
+
+func TestCanonicalTOMLNestedTable(t *testing.T) {
+	front := []byte("+++\ntitle = \"Hi\"\n[params]\nzebra = \"z\"\napple = \"a\"\n+++\n")
+	got, err := canonicalTOML(front)
+	if err != nil {
+		t.Fatalf("canonicalTOML: %v", err)
+	}
+	if bytes.Contains(got, []byte("map[")) {
+		t.Errorf("canonicalTOML(%q) = %s, nested table was stringified as a Go map instead of canonicalized", front, got)
+	}
+	if !bytes.Contains(got, []byte(`apple = "a"`)) || !bytes.Contains(got, []byte(`zebra = "z"`)) {
+		t.Errorf("canonicalTOML(%q) = %s, want both nested params rendered", front, got)
+	}
+	appleAt := bytes.Index(got, []byte(`apple = "a"`))
+	zebraAt := bytes.Index(got, []byte(`zebra = "z"`))
+	if appleAt < 0 || zebraAt < 0 || appleAt > zebraAt {
+		t.Errorf("canonicalTOML(%q) = %s, want nested table keys sorted apple < zebra", front, got)
+	}
+}
@@ -0,0 +1,598 @@
+package fmtcmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// rewriteRule is a single parsed -r 'pattern -> replacement' rule. Unlike
+// gofmt's textual go/ast rewrites, markdownfmt rules match at the level of
+// goldmark AST node kinds (heading, link, image, code) rather than source
+// text, since Markdown's concrete syntax is too varied to pattern-match
+// reliably.
+type rewriteRule struct {
+	pattern string // original "pattern -> replacement" text, for error messages
+	apply   func(n ast.Node, source *[]byte) bool
+}
+
+// rawArg is one parsed argument of a pattern or replacement term, e.g. the
+// "n", "lang=\"\"", "n+1", or "canonical(url)" in "heading(n, x) ->
+// heading(n+1, x)". Exactly one of ident, (ident,hasDelta), (ident,fn), or
+// (literal,hasLit) is meaningful for a given argument, depending on which
+// of the forms it was parsed from.
+type rawArg struct {
+	ident    string // bare capture name, or the operand of delta/fn forms
+	hasDelta bool
+	delta    int    // set with hasDelta, from "ident+N" / "ident-N"
+	fn       string // set to a wrapper function name, from "fn(ident)"
+	literal  string
+	hasLit   bool // set from "name=\"value\"" or a bare quoted string
+}
+
+var (
+	termPattern   = regexp.MustCompile(`^(\w+)\((.*)\)$`)
+	fnCallPattern = regexp.MustCompile(`^(\w+)\(([^()]*)\)$`)
+	deltaPattern  = regexp.MustCompile(`^(\w+)\s*([+-])\s*(\d+)$`)
+	identPattern  = regexp.MustCompile(`^\w+$`)
+)
+
+// ruleKind identifies a transform by the node kind its pattern and
+// replacement terms name, e.g. {"heading", "heading"} or the cross-kind
+// {"image", "link"}.
+type ruleKind struct{ pattern, replacement string }
+
+// ruleBuilders maps each supported (pattern kind, replacement kind) pair to
+// a function that validates a parsed rule's arguments against that kind's
+// shape and, if they fit, returns the apply func for it. This is the set of
+// node-level transforms -r understands; everything else is rejected with
+// "unsupported rewrite rule".
+var ruleBuilders = map[ruleKind]func(expr string, pat, repl []rawArg) (func(ast.Node, *[]byte) bool, error){
+	{"heading", "heading"}: buildHeadingRule,
+	{"code", "code"}:       buildCodeRule,
+	{"image", "link"}:      buildImageToLinkRule,
+	{"link", "link"}:       buildLinkRule,
+}
+
+// parseRewriteRule parses the -r flag's "pattern -> replacement" syntax: two
+// name(args) terms naming a goldmark node kind, with capture variables
+// (bound by position, not by the name chosen for them) threaded from
+// pattern to replacement. Only the node-level transforms in ruleBuilders
+// are supported; anything else is a parse error naming the unsupported
+// form.
+func parseRewriteRule(expr string) (rewriteRule, error) {
+	parts := strings.SplitN(expr, "->", 2)
+	if len(parts) != 2 {
+		return rewriteRule{}, fmt.Errorf("rewrite rule %q must have the form 'pattern -> replacement'", expr)
+	}
+
+	patName, patArgs, err := parseTerm(parts[0])
+	if err != nil {
+		return rewriteRule{}, fmt.Errorf("rewrite rule %q: invalid pattern: %w", expr, err)
+	}
+	replName, replArgs, err := parseTerm(parts[1])
+	if err != nil {
+		return rewriteRule{}, fmt.Errorf("rewrite rule %q: invalid replacement: %w", expr, err)
+	}
+
+	builder, ok := ruleBuilders[ruleKind{patName, replName}]
+	if !ok {
+		return rewriteRule{}, fmt.Errorf("unsupported rewrite rule %q: no transform from %s(...) to %s(...)", expr, patName, replName)
+	}
+	apply, err := builder(expr, patArgs, replArgs)
+	if err != nil {
+		return rewriteRule{}, err
+	}
+	return rewriteRule{pattern: expr, apply: apply}, nil
+}
+
+// parseTerm parses one side of a rule, "name(arg, arg, ...)".
+func parseTerm(s string) (name string, args []rawArg, err error) {
+	m := termPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return "", nil, fmt.Errorf("expected the form name(args), got %q", strings.TrimSpace(s))
+	}
+	fields, err := splitArgs(m[2])
+	if err != nil {
+		return "", nil, err
+	}
+	args = make([]rawArg, len(fields))
+	for i, f := range fields {
+		a, err := parseArg(f)
+		if err != nil {
+			return "", nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		args[i] = a
+	}
+	return m[1], args, nil
+}
+
+// splitArgs splits a term's argument list on top-level commas, ignoring
+// commas nested inside a function-call argument like "canonical(url)" or a
+// quoted literal.
+func splitArgs(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	depth := 0
+	inQuote := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+			}
+		case r == ',' && depth == 0:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	if depth != 0 || inQuote {
+		return nil, fmt.Errorf("unbalanced parentheses or quotes in %q", s)
+	}
+	return append(fields, s[start:]), nil
+}
+
+// parseArg parses one argument: a bare capture name, a "name=\"literal\""
+// constraint/assignment, an "ident+N"/"ident-N" delta, a "fn(ident)"
+// wrapper call, or a bare quoted literal.
+func parseArg(s string) (rawArg, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return rawArg{}, fmt.Errorf("empty argument")
+	}
+	if eq := strings.IndexByte(s, '='); eq >= 0 {
+		key := strings.TrimSpace(s[:eq])
+		val := strings.TrimSpace(s[eq+1:])
+		if !identPattern.MatchString(key) {
+			return rawArg{}, fmt.Errorf("invalid argument name %q", key)
+		}
+		lit, err := strconv.Unquote(val)
+		if err != nil {
+			return rawArg{}, fmt.Errorf("invalid literal %q: %w", val, err)
+		}
+		return rawArg{ident: key, literal: lit, hasLit: true}, nil
+	}
+	if m := fnCallPattern.FindStringSubmatch(s); m != nil {
+		inner := strings.TrimSpace(m[2])
+		if !identPattern.MatchString(inner) {
+			return rawArg{}, fmt.Errorf("invalid argument to %s(...): %q", m[1], inner)
+		}
+		return rawArg{ident: inner, fn: m[1]}, nil
+	}
+	if m := deltaPattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[3])
+		if m[2] == "-" {
+			n = -n
+		}
+		return rawArg{ident: m[1], hasDelta: true, delta: n}, nil
+	}
+	if identPattern.MatchString(s) {
+		return rawArg{ident: s}, nil
+	}
+	if lit, err := strconv.Unquote(s); err == nil {
+		return rawArg{literal: lit, hasLit: true}, nil
+	}
+	return rawArg{}, fmt.Errorf("cannot parse argument %q", s)
+}
+
+// patternCapture returns a's capture name, rejecting any pattern argument
+// that isn't a plain name (patterns bind variables; only a handful of
+// known slots, like code's lang, accept a literal constraint instead).
+func patternCapture(expr string, a rawArg) (string, error) {
+	if a.hasLit || a.hasDelta || a.fn != "" {
+		return "", fmt.Errorf("rewrite rule %q: pattern arguments must be plain names, not %q", expr, a.ident+a.literal)
+	}
+	return a.ident, nil
+}
+
+// requireSameCapture checks that a slot the rule doesn't transform (e.g.
+// heading's text, or a link's visible text) is passed through unchanged:
+// the replacement must reference the exact same capture pat bound, however
+// it was named.
+func requireSameCapture(expr, what string, pat, repl rawArg) error {
+	pv, err := patternCapture(expr, pat)
+	if err != nil {
+		return err
+	}
+	if repl.hasLit || repl.hasDelta || repl.fn != "" || repl.ident != pv {
+		return fmt.Errorf("rewrite rule %q: %s is passed through unchanged and must stay %q in the replacement", expr, what, pv)
+	}
+	return nil
+}
+
+// buildHeadingRule implements rules of the form "heading(level, text) ->
+// heading(level+N, text)", demoting (or promoting, for negative N) a
+// heading's level and leaving its content untouched.
+func buildHeadingRule(expr string, pat, repl []rawArg) (func(ast.Node, *[]byte) bool, error) {
+	if len(pat) != 2 || len(repl) != 2 {
+		return nil, fmt.Errorf("rewrite rule %q: heading takes exactly 2 arguments", expr)
+	}
+	levelVar, err := patternCapture(expr, pat[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := requireSameCapture(expr, "heading text", pat[1], repl[1]); err != nil {
+		return nil, err
+	}
+
+	var delta int
+	switch {
+	case repl[0].hasDelta && repl[0].ident == levelVar:
+		delta = repl[0].delta
+	case !repl[0].hasLit && !repl[0].hasDelta && repl[0].fn == "" && repl[0].ident == levelVar:
+		delta = 0
+	default:
+		return nil, fmt.Errorf("rewrite rule %q: heading level replacement must be %s or %s+N", expr, levelVar, levelVar)
+	}
+
+	// applyRewrites re-walks doc to a fixed point, so a heading already
+	// shifted by this rule must not be shifted again on the next pass; done
+	// tracks which nodes this rule instance has already applied to. The
+	// rule is shared by every file in a run, which are formatted
+	// concurrently, so mu guards done.
+	var mu sync.Mutex
+	done := map[*ast.Heading]bool{}
+	return func(n ast.Node, source *[]byte) bool {
+		h, ok := n.(*ast.Heading)
+		if !ok {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if done[h] {
+			return false
+		}
+		newLevel := h.Level + delta
+		if newLevel < 1 {
+			newLevel = 1
+		} else if newLevel > 6 {
+			newLevel = 6
+		}
+		done[h] = true
+		if newLevel == h.Level {
+			return false
+		}
+		h.Level = newLevel
+		return true
+	}, nil
+}
+
+// buildCodeRule implements rules of the form "code(lang=\"a\", body) ->
+// code(lang=\"b\", body)", retagging a fenced code block's language and
+// leaving its body untouched.
+func buildCodeRule(expr string, pat, repl []rawArg) (func(ast.Node, *[]byte) bool, error) {
+	if len(pat) != 2 || len(repl) != 2 {
+		return nil, fmt.Errorf("rewrite rule %q: code takes exactly 2 arguments", expr)
+	}
+	if !pat[0].hasLit {
+		return nil, fmt.Errorf("rewrite rule %q: code's lang argument must be a literal, e.g. lang=\"\"", expr)
+	}
+	if !repl[0].hasLit {
+		return nil, fmt.Errorf("rewrite rule %q: code's replacement lang must be a literal, e.g. lang=\"text\"", expr)
+	}
+	wantLang, newLang := pat[0].literal, repl[0].literal
+	if err := requireSameCapture(expr, "code body", pat[1], repl[1]); err != nil {
+		return nil, err
+	}
+
+	return func(n ast.Node, source *[]byte) bool {
+		fcb, ok := n.(*ast.FencedCodeBlock)
+		if !ok {
+			return false
+		}
+		cur := ""
+		if fcb.Info != nil {
+			cur = string(fcb.Info.Text(*source))
+		}
+		if cur != wantLang || cur == newLang {
+			return false
+		}
+		// ast.Text nodes reference a byte range in the shared source rather
+		// than holding literal bytes, so a synthesized language tag has to
+		// be appended to source itself before a Segment can point at it.
+		start := len(*source)
+		*source = append(*source, newLang...)
+		fcb.Info = ast.NewTextSegment(text.NewSegment(start, len(*source)))
+		return true
+	}, nil
+}
+
+// buildImageToLinkRule implements "image(alt, url) -> link(alt, url)",
+// replacing a bare image with a link wrapping the same content; neither
+// side may transform its arguments since there is nothing left to change
+// once the node kind itself has switched.
+func buildImageToLinkRule(expr string, pat, repl []rawArg) (func(ast.Node, *[]byte) bool, error) {
+	if len(pat) != 2 || len(repl) != 2 {
+		return nil, fmt.Errorf("rewrite rule %q: image/link take exactly 2 arguments", expr)
+	}
+	if err := requireSameCapture(expr, "alt text", pat[0], repl[0]); err != nil {
+		return nil, err
+	}
+	if err := requireSameCapture(expr, "url", pat[1], repl[1]); err != nil {
+		return nil, err
+	}
+	return imageToLink, nil
+}
+
+// buildLinkRule implements "link(text, url) -> link(text, canonical(url))",
+// lower-casing a link destination's scheme/host and dropping a redundant
+// trailing slash; canonical is the only supported url transform.
+func buildLinkRule(expr string, pat, repl []rawArg) (func(ast.Node, *[]byte) bool, error) {
+	if len(pat) != 2 || len(repl) != 2 {
+		return nil, fmt.Errorf("rewrite rule %q: link takes exactly 2 arguments", expr)
+	}
+	if err := requireSameCapture(expr, "link text", pat[0], repl[0]); err != nil {
+		return nil, err
+	}
+	urlVar, err := patternCapture(expr, pat[1])
+	if err != nil {
+		return nil, err
+	}
+	if repl[1].fn == "" || repl[1].ident != urlVar {
+		return nil, fmt.Errorf("rewrite rule %q: link's replacement url must be canonical(%s)", expr, urlVar)
+	}
+	if repl[1].fn != "canonical" {
+		return nil, fmt.Errorf("rewrite rule %q: unknown url transform %q (only canonical is supported)", expr, repl[1].fn)
+	}
+	return canonicalizeLink, nil
+}
+
+// applyRewrites walks doc repeatedly, applying rules until a full pass
+// makes no further change (a fixed point), mirroring gofmt's -r semantics
+// of rewriting until the pattern no longer matches.
+func applyRewrites(doc ast.Node, source *[]byte, rules []rewriteRule) error {
+	for {
+		changed := false
+		err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if !entering {
+				return ast.WalkContinue, nil
+			}
+			for _, r := range rules {
+				if r.apply(n, source) {
+					changed = true
+				}
+			}
+			return ast.WalkContinue, nil
+		})
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+	}
+}
+
+// imageToLink implements image(alt, url) -> link(alt, url), replacing a
+// bare image with a link wrapping the same alt text.
+func imageToLink(n ast.Node, source *[]byte) bool {
+	img, ok := n.(*ast.Image)
+	if !ok {
+		return false
+	}
+	parent := img.Parent()
+	if parent == nil {
+		return false
+	}
+	link := ast.NewLink()
+	link.Destination = img.Destination
+	link.Title = img.Title
+	for c := img.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		img.RemoveChild(img, c)
+		link.AppendChild(link, c)
+		c = next
+	}
+	parent.ReplaceChild(parent, img, link)
+	return true
+}
+
+// canonicalizeLink implements link(text, url) -> link(text, canonical(url)),
+// lower-casing the destination's scheme/host and dropping a redundant
+// trailing slash.
+func canonicalizeLink(n ast.Node, source *[]byte) bool {
+	link, ok := n.(*ast.Link)
+	if !ok {
+		return false
+	}
+	u, err := url.Parse(string(link.Destination))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	canon := canonicalURL(u)
+	if canon == string(link.Destination) {
+		return false
+	}
+	link.Destination = []byte(canon)
+	return true
+}
+
+func canonicalURL(u *url.URL) string {
+	c := *u
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Host = strings.ToLower(c.Host)
+	if c.Path != "/" {
+		c.Path = strings.TrimSuffix(c.Path, "/")
+	}
+	return c.String()
+}
+
+// simplifyRules is the node-level subset of the -s bundle; -s also runs
+// inlineSingleUseReferenceLinks, which needs the whole source text rather
+// than a single node and so is applied separately.
+func simplifyRules() []rewriteRule {
+	return []rewriteRule{
+		{pattern: "-s: collapse blank lines in block quotes", apply: collapseBlockquoteBlanks},
+		{pattern: "-s: drop empty emphasis", apply: dropEmptyEmphasis},
+		{pattern: "-s: strip trailing hard break", apply: stripTrailingHardBreak},
+	}
+}
+
+// collapseBlockquoteBlanks removes consecutive blank-line paragraphs
+// inside a block quote, which render identically to a single blank line
+// but needlessly bloat the source.
+func collapseBlockquoteBlanks(n ast.Node, source *[]byte) bool {
+	bq, ok := n.(*ast.Blockquote)
+	if !ok {
+		return false
+	}
+	changed := false
+	sawBlank := false
+	for c := bq.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		if isBlankParagraph(c, source) {
+			if sawBlank {
+				bq.RemoveChild(bq, c)
+				changed = true
+				c = next
+				continue
+			}
+			sawBlank = true
+		} else {
+			sawBlank = false
+		}
+		c = next
+	}
+	return changed
+}
+
+func isBlankParagraph(n ast.Node, source *[]byte) bool {
+	p, ok := n.(*ast.Paragraph)
+	return ok && len(bytes.TrimSpace(p.Text(*source))) == 0
+}
+
+// dropEmptyEmphasis removes **/__/*/_ spans with no content, which render
+// as literal asterisks in some renderers instead of disappearing.
+func dropEmptyEmphasis(n ast.Node, source *[]byte) bool {
+	em, ok := n.(*ast.Emphasis)
+	if !ok || em.FirstChild() != nil {
+		return false
+	}
+	parent := em.Parent()
+	if parent == nil {
+		return false
+	}
+	parent.RemoveChild(parent, em)
+	return true
+}
+
+// trailingBRPattern matches a literal "<br>" tag, with or without the
+// self-closing slash and surrounding space, and is case-insensitive since
+// browsers treat "<BR>" the same as "<br>".
+var trailingBRPattern = regexp.MustCompile(`(?i)^<br\s*/?>$`)
+
+// stripTrailingHardBreak removes a literal "<br>" HTML tag that is the last
+// child of a paragraph, since the paragraph boundary already breaks the
+// line there and the tag has no visual effect. A goldmark hard line break
+// (trailing double-space or backslash) is a distinct, already-semantic
+// construct and isn't touched by this rule.
+func stripTrailingHardBreak(n ast.Node, source *[]byte) bool {
+	p, ok := n.(*ast.Paragraph)
+	if !ok {
+		return false
+	}
+	last, ok := p.LastChild().(*ast.RawHTML)
+	if !ok {
+		return false
+	}
+
+	var raw []byte
+	for i := 0; i < last.Segments.Len(); i++ {
+		seg := last.Segments.At(i)
+		raw = append(raw, seg.Value(*source)...)
+	}
+	if !trailingBRPattern.Match(bytes.TrimSpace(raw)) {
+		return false
+	}
+
+	p.RemoveChild(p, last)
+	return true
+}
+
+// refLinkPattern matches a Markdown reference-style link: [text][ref] or
+// the shorthand [text][].
+var refLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\[([^\]]*)\]`)
+
+// refDefPattern matches a reference definition line: [ref]: url "title".
+var refDefPattern = regexp.MustCompile(`(?m)^\[([^\]]+)\]:\s*(\S+)(?:\s+"([^"]*)")?\s*$`)
+
+// inlineSingleUseReferenceLinks rewrites [text][ref] to [text](url) when
+// ref is used exactly once in the document, then drops the now-unused
+// reference definition. It operates on raw text rather than the AST
+// because, once parsed, reference and inline links are indistinguishable
+// goldmark *ast.Link nodes.
+func inlineSingleUseReferenceLinks(source []byte) []byte {
+	defs := map[string]struct{ url, title string }{}
+	for _, m := range refDefPattern.FindAllSubmatch(source, -1) {
+		defs[strings.ToLower(string(m[1]))] = struct{ url, title string }{string(m[2]), string(m[3])}
+	}
+	if len(defs) == 0 {
+		return source
+	}
+
+	uses := map[string]int{}
+	for _, m := range refLinkPattern.FindAllSubmatch(source, -1) {
+		ref := string(m[2])
+		if ref == "" {
+			ref = string(m[1]) // shorthand [text][] refers to "text"
+		}
+		uses[strings.ToLower(ref)]++
+	}
+
+	out := refLinkPattern.ReplaceAllFunc(source, func(match []byte) []byte {
+		m := refLinkPattern.FindSubmatch(match)
+		text, ref := string(m[1]), string(m[2])
+		if ref == "" {
+			ref = text
+		}
+		key := strings.ToLower(ref)
+		def, ok := defs[key]
+		if !ok || uses[key] != 1 {
+			return match
+		}
+		if def.title != "" {
+			return []byte(fmt.Sprintf("[%s](%s %q)", text, def.url, def.title))
+		}
+		return []byte(fmt.Sprintf("[%s](%s)", text, def.url))
+	})
+
+	return refDefPattern.ReplaceAllFunc(out, func(match []byte) []byte {
+		m := refDefPattern.FindSubmatch(match)
+		if uses[strings.ToLower(string(m[1]))] == 1 {
+			return nil
+		}
+		return match
+	})
+}
+
+// parseRFlags parses the repeatable -r flag values into rules, reporting
+// the first invalid rule exactly like gofmt does.
+func parseRFlags(exprs []string) ([]rewriteRule, error) {
+	rules := make([]rewriteRule, 0, len(exprs))
+	for _, expr := range exprs {
+		r, err := parseRewriteRule(expr)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
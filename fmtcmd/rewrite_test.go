@@ -0,0 +1,112 @@
+package fmtcmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	gmtext "github.com/yuin/goldmark/text"
+)
+
+// applyRuleToSource parses src, applies rule to a fixed point, and returns
+// the mutated document together with the (possibly extended, by a code
+// rule's literal replacement) source bytes the document now refers to.
+func applyRuleToSource(t *testing.T, rule rewriteRule, src string) (ast.Node, []byte) {
+	t.Helper()
+	source := []byte(src)
+	gm := goldmark.New()
+	doc := gm.Parser().Parse(gmtext.NewReader(source))
+	if err := applyRewrites(doc, &source, []rewriteRule{rule}); err != nil {
+		t.Fatalf("applyRewrites(%q): %v", src, err)
+	}
+	return doc, source
+}
+
+func findNode(doc ast.Node, kind ast.NodeKind) ast.Node {
+	var found ast.Node
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && n.Kind() == kind && found == nil {
+			found = n
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
+}
+
+func TestRewriteRules(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		src  string
+		// check inspects the rewritten document and source to confirm the
+		// rule fired as expected.
+		check func(t *testing.T, doc ast.Node, source []byte)
+	}{
+		{
+			name: "heading demote",
+			expr: `heading(n, x) -> heading(n+1, x)`,
+			src:  "# Title\n",
+			check: func(t *testing.T, doc ast.Node, source []byte) {
+				h := findNode(doc, ast.KindHeading).(*ast.Heading)
+				if h.Level != 2 {
+					t.Errorf("heading level = %d, want 2", h.Level)
+				}
+			},
+		},
+		{
+			name: "code relabel",
+			expr: `code(lang="js", body) -> code(lang="javascript", body)`,
+			src:  "```js\nconsole.log(1)\n```\n",
+			check: func(t *testing.T, doc ast.Node, source []byte) {
+				fcb := findNode(doc, ast.KindFencedCodeBlock).(*ast.FencedCodeBlock)
+				if got := string(fcb.Info.Text(source)); got != "javascript" {
+					t.Errorf("fenced code info = %q, want %q", got, "javascript")
+				}
+			},
+		},
+		{
+			name: "image to link",
+			expr: `image(alt, url) -> link(alt, url)`,
+			src:  "![alt](http://example.com/x.png)\n",
+			check: func(t *testing.T, doc ast.Node, source []byte) {
+				if n := findNode(doc, ast.KindImage); n != nil {
+					t.Errorf("image still present after image->link rewrite")
+				}
+				link := findNode(doc, ast.KindLink)
+				if link == nil {
+					t.Fatalf("no link node found after image->link rewrite")
+				}
+			},
+		},
+		{
+			name: "link canonicalize",
+			expr: `link(text, url) -> link(text, canonical(url))`,
+			src:  "[x](HTTP://Example.com/path/)\n",
+			check: func(t *testing.T, doc ast.Node, source []byte) {
+				link := findNode(doc, ast.KindLink).(*ast.Link)
+				if got := string(link.Destination); got != "http://example.com/path" {
+					t.Errorf("link destination = %q, want %q", got, "http://example.com/path")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRewriteRule(tt.expr)
+			if err != nil {
+				t.Fatalf("parseRewriteRule(%q): %v", tt.expr, err)
+			}
+			doc, source := applyRuleToSource(t, rule, tt.src)
+			tt.check(t, doc, source)
+		})
+	}
+}
+
+func TestParseRewriteRuleRejectsUnsupportedKind(t *testing.T) {
+	_, err := parseRewriteRule(`strong(x) -> strong(x)`)
+	if err == nil || !strings.Contains(err.Error(), "unsupported rewrite rule") {
+		t.Fatalf("parseRewriteRule(strong(x) -> strong(x)) error = %v, want an unsupported rewrite rule error", err)
+	}
+}
@@ -0,0 +1,155 @@
+package fmtcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SARIF 2.1.0 (https://docs.oasis-open.org/sarif/sarif/v2.1.0) output for
+// -check, so markdownfmt can run as a first-class check in GitHub Code
+// Scanning and similar CI integrations: each unformatted file becomes one
+// result carrying a fix with the fully formatted replacement text.
+
+const sarifRuleID = "markdownfmt/unformatted"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion          `json:"deletedRegion"`
+	InsertedContent sarifInsertedContent `json:"insertedContent"`
+}
+
+// sarifRegion covers the whole file: markdownfmt's fix is always a full
+// replacement, so there is no need to track per-hunk regions here (Hunks
+// is still reported separately in -output=json for that level of detail).
+// EndLine must be set to the original file's last line, or consumers see a
+// one-line deletedRegion paired with a multi-line insertedContent and
+// render (or reject) the suggestion incorrectly.
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// countLines reports how many lines b contains, counting a trailing
+// unterminated line but not a trailing "\n" itself (so "a\nb" and "a\nb\n"
+// both report 2).
+func countLines(b []byte) int {
+	if len(b) == 0 {
+		return 0
+	}
+	n := bytes.Count(b, []byte("\n"))
+	if !bytes.HasSuffix(b, []byte("\n")) {
+		n++
+	}
+	return n
+}
+
+type sarifInsertedContent struct {
+	Text string `json:"text"`
+}
+
+func writeSARIFReport(w io.Writer, results []fileCheckResult) error {
+	var sarifResults []sarifResult
+	for _, res := range results {
+		if !res.Changed {
+			continue
+		}
+		sarifResults = append(sarifResults, sarifResult{
+			RuleID: sarifRuleID,
+			Level:  "warning",
+			Message: sarifMessage{
+				Text: fmt.Sprintf("%s is not formatted with markdownfmt", res.Path),
+			},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: res.Path},
+				},
+			}},
+			Fixes: []sarifFix{{
+				Description: sarifMessage{Text: "Run markdownfmt -w"},
+				ArtifactChanges: []sarifArtifactChange{{
+					ArtifactLocation: sarifArtifactLocation{URI: res.Path},
+					Replacements: []sarifReplacement{{
+						DeletedRegion:   sarifRegion{StartLine: 1, EndLine: countLines(res.src)},
+						InsertedContent: sarifInsertedContent{Text: string(res.formatted)},
+					}},
+				}},
+			}},
+		})
+	}
+
+	doc := sarifLog{
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:  "markdownfmt",
+				Rules: []sarifRule{{ID: sarifRuleID, ShortDescription: sarifMessage{Text: "Reports Markdown files not formatted with markdownfmt"}}},
+			}},
+			Results: sarifResults,
+		}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,318 @@
+// Package diff computes unified diffs between two byte slices without
+// shelling out to an external diff binary, so markdownfmt's -d flag works
+// the same on Windows and in minimal containers as it does anywhere else.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Diff returns a unified diff turning old into new, line-tokenized and
+// computed with Myers' O(ND) algorithm, with context lines of unchanged
+// context around each hunk (diff -u's default is 3). oldName and newName
+// are used in the --- / +++ headers. Diff returns nil if old and new
+// contain the same lines.
+func Diff(oldName, newName string, old, new []byte, context int) []byte {
+	oldLines := splitLines(old)
+	newLines := splitLines(new)
+
+	ops := diffLines(oldLines, newLines)
+	hunks := hunksFromOps(ops, context)
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- a/%s\n", oldName)
+	fmt.Fprintf(&buf, "+++ b/%s\n", newName)
+	for _, h := range hunks {
+		writeHunk(&buf, h, oldLines, newLines)
+	}
+	return buf.Bytes()
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	lines := strings.Split(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		// b ended in "\n"; the trailing empty element isn't a line.
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// op is one step of the edit script turning old into new. oldI and newI
+// are always the 0-based cursor position in oldLines/newLines immediately
+// before this op is applied, so they double as content indices for the
+// kinds that consume from that side (equal/delete read oldLines[oldI],
+// equal/insert read newLines[newI]).
+type op struct {
+	kind       opKind
+	oldI, newI int
+}
+
+// diffLines computes the minimal edit script turning a into b via Myers'
+// algorithm: find the shortest edit trace, then walk it backwards to
+// recover the operations, then fill in each op's cursor position on the
+// side it doesn't directly consume (needed to anchor hunks that start
+// with a pure insertion or deletion).
+func diffLines(a, b []string) []op {
+	trace := shortestEditTrace(a, b)
+	ops := backtrack(a, b, trace)
+
+	oldPos, newPos := 0, 0
+	for i := range ops {
+		switch ops[i].kind {
+		case opInsert:
+			ops[i].oldI = oldPos
+		case opDelete:
+			ops[i].newI = newPos
+		}
+		switch ops[i].kind {
+		case opEqual:
+			oldPos++
+			newPos++
+		case opDelete:
+			oldPos++
+		case opInsert:
+			newPos++
+		}
+	}
+	return ops
+}
+
+// shortestEditTrace runs Myers' greedy algorithm over the edit graph of a
+// and b, recording the frontier (the "v" array) at every edit distance so
+// backtrack can recover an actual edit script afterward.
+func shortestEditTrace(a, b []string) [][]int {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	offset := max
+	v := make([]int, 2*max+1)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return trace
+			}
+		}
+	}
+	return trace
+}
+
+// backtrack walks the trace produced by shortestEditTrace from the end
+// state back to the start, recovering a forward-ordered sequence of
+// equal/delete/insert operations.
+func backtrack(a, b []string, trace [][]int) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	offset := max
+	x, y := n, m
+	var ops []op // built end-to-start; reversed before returning
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		switch {
+		case k == -d:
+			prevK = k + 1
+		case k != d && v[offset+k-1] < v[offset+k+1]:
+			prevK = k + 1
+		default:
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{kind: opEqual, oldI: x, newI: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, op{kind: opInsert, newI: y})
+			} else {
+				x--
+				ops = append(ops, op{kind: opDelete, oldI: x})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunk is a contiguous run of ops (with up to context lines of unchanged
+// context on either side) that gets rendered as one "@@ ... @@" block.
+type hunk struct {
+	ops []op
+}
+
+// hunksFromOps groups a flat edit script into hunks, each surrounded by up
+// to context lines of unchanged context, merging changes separated by at
+// most 2*context unchanged lines, whose context regions would otherwise
+// overlap or touch.
+func hunksFromOps(ops []op, context int) []hunk {
+	if context < 0 {
+		context = 0
+	}
+
+	var hunks []hunk
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		start := i
+		for start > 0 && i-start < context && ops[start-1].kind == opEqual {
+			start--
+		}
+
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == opEqual {
+				run++
+			}
+			if run > 2*context || end+run >= len(ops) {
+				extra := run
+				if extra > context {
+					extra = context
+				}
+				end += extra
+				break
+			}
+			end += run
+		}
+
+		hunks = append(hunks, hunk{ops: append([]op(nil), ops[start:end]...)})
+		i = end
+	}
+	return hunks
+}
+
+// hunkRange reports a hunk's "@@ -oldStart,oldLines +newStart,newLines @@"
+// numbers (oldStart/newStart already 1-based).
+func hunkRange(h hunk) (oldStart, oldLines, newStart, newLines int) {
+	if len(h.ops) == 0 {
+		return
+	}
+	oldStart, newStart = h.ops[0].oldI+1, h.ops[0].newI+1
+	for _, o := range h.ops {
+		switch o.kind {
+		case opEqual:
+			oldLines++
+			newLines++
+		case opDelete:
+			oldLines++
+		case opInsert:
+			newLines++
+		}
+	}
+	return
+}
+
+// writeHunk renders one hunk in unified-diff form: an "@@ -old,len
+// +new,len @@" header followed by the hunk's context/added/removed lines.
+func writeHunk(buf *bytes.Buffer, h hunk, oldLines, newLines []string) {
+	if len(h.ops) == 0 {
+		return
+	}
+
+	oldStart, oldCount, newStart, newCount := hunkRange(h)
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, o := range h.ops {
+		switch o.kind {
+		case opEqual:
+			fmt.Fprintf(buf, " %s\n", oldLines[o.oldI])
+		case opDelete:
+			fmt.Fprintf(buf, "-%s\n", oldLines[o.oldI])
+		case opInsert:
+			fmt.Fprintf(buf, "+%s\n", newLines[o.newI])
+		}
+	}
+}
+
+// Hunk is the structured form of one unified-diff hunk: the same data
+// Diff renders as text, for callers (like fmtcmd's -output=json/sarif)
+// that want to consume hunk boundaries programmatically instead of
+// parsing them back out of a patch.
+type Hunk struct {
+	OldStart int    `json:"oldStart"`
+	OldLines int    `json:"oldLines"`
+	NewStart int    `json:"newStart"`
+	NewLines int    `json:"newLines"`
+	Patch    string `json:"patch"`
+}
+
+// Hunks returns the hunks Diff would render between old and new, as
+// structured data instead of pre-formatted bytes.
+func Hunks(old, new []byte, context int) []Hunk {
+	oldLines := splitLines(old)
+	newLines := splitLines(new)
+	ops := diffLines(oldLines, newLines)
+	raw := hunksFromOps(ops, context)
+
+	hunks := make([]Hunk, len(raw))
+	for i, h := range raw {
+		oldStart, oldCount, newStart, newCount := hunkRange(h)
+		var buf bytes.Buffer
+		writeHunk(&buf, h, oldLines, newLines)
+		hunks[i] = Hunk{
+			OldStart: oldStart,
+			OldLines: oldCount,
+			NewStart: newStart,
+			NewLines: newCount,
+			Patch:    buf.String(),
+		}
+	}
+	return hunks
+}
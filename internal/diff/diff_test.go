@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffIdentical(t *testing.T) {
+	old := []byte("a\nb\nc\n")
+	if got := Diff("old", "new", old, old, 3); got != nil {
+		t.Errorf("Diff(old, old) = %q, want nil", got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{
+			name: "single line changed",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "--- a/old\n" +
+				"+++ b/new\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" a\n" +
+				"-b\n" +
+				"+B\n" +
+				" c\n",
+		},
+		{
+			name: "pure insertion",
+			old:  "a\nc\n",
+			new:  "a\nb\nc\n",
+			want: "--- a/old\n" +
+				"+++ b/new\n" +
+				"@@ -1,2 +1,3 @@\n" +
+				" a\n" +
+				"+b\n" +
+				" c\n",
+		},
+		{
+			name: "pure deletion",
+			old:  "a\nb\nc\n",
+			new:  "a\nc\n",
+			want: "--- a/old\n" +
+				"+++ b/new\n" +
+				"@@ -1,3 +1,2 @@\n" +
+				" a\n" +
+				"-b\n" +
+				" c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff("old", "new", []byte(tt.old), []byte(tt.new), 3)
+			if string(got) != tt.want {
+				t.Errorf("Diff(%q, %q) =\n%s\nwant\n%s", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffMergesCloseHunks(t *testing.T) {
+	// Two single-line changes separated by three unchanged lines, with
+	// context=3, should merge into a single hunk rather than two.
+	old := strings.Join([]string{"1", "x", "3", "4", "5", "y", "7"}, "\n") + "\n"
+	new := strings.Join([]string{"1", "X", "3", "4", "5", "Y", "7"}, "\n") + "\n"
+
+	got := Diff("old", "new", []byte(old), []byte(new), 3)
+	if n := strings.Count(string(got), "@@"); n != 2 {
+		t.Errorf("Diff produced %d hunk headers (%d '@@' markers), want a single merged hunk:\n%s", n/2, n, got)
+	}
+}
+
+func TestHunks(t *testing.T) {
+	old := []byte("a\nb\nc\n")
+	new := []byte("a\nB\nc\n")
+
+	hunks := Hunks(old, new, 3)
+	if len(hunks) != 1 {
+		t.Fatalf("Hunks returned %d hunks, want 1", len(hunks))
+	}
+	h := hunks[0]
+	if h.OldStart != 1 || h.OldLines != 3 || h.NewStart != 1 || h.NewLines != 3 {
+		t.Errorf("Hunks()[0] = %+v, want OldStart=1 OldLines=3 NewStart=1 NewLines=3", h)
+	}
+	if !strings.Contains(h.Patch, "-b\n") || !strings.Contains(h.Patch, "+B\n") {
+		t.Errorf("Hunks()[0].Patch = %q, want it to contain the -b/+B lines", h.Patch)
+	}
+}
+
+func TestHunksNoChange(t *testing.T) {
+	same := []byte("a\nb\nc\n")
+	if hunks := Hunks(same, same, 3); len(hunks) != 0 {
+		t.Errorf("Hunks(same, same) = %v, want none", hunks)
+	}
+}